@@ -0,0 +1,98 @@
+package adapter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roffe/gocan"
+)
+
+// candumpChannel is the interface name written into candump-format lines.
+// gocan adapters only ever speak a single logical CAN bus, so the value is
+// fixed rather than threaded through from the caller.
+const candumpChannel = "can0"
+
+// writeCandumpLine appends frame to w in candump -L format, e.g.
+// (1700000000.123456) can0 7E0#0210011122334455
+func writeCandumpLine(w io.Writer, ts time.Time, frame gocan.CANFrame) error {
+	_, err := fmt.Fprintf(w, "(%d.%06d) %s %X#%X\n",
+		ts.Unix(), ts.Nanosecond()/1000, candumpChannel, frame.Identifier(), frame.Data())
+	return err
+}
+
+// parseCandumpLine parses a single candump -L formatted line into a
+// timestamp and CAN frame. Lines that don't match the format return an
+// error.
+func parseCandumpLine(line string, direction gocan.CANFrameType) (time.Time, gocan.CANFrame, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || !strings.HasPrefix(line, "(") {
+		return time.Time{}, nil, fmt.Errorf("not a candump line: %q", line)
+	}
+
+	end := strings.IndexByte(line, ')')
+	if end < 0 {
+		return time.Time{}, nil, fmt.Errorf("malformed timestamp in line: %q", line)
+	}
+	tsStr := line[1:end]
+	secStr, nsecStr, _ := strings.Cut(tsStr, ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("bad seconds in %q: %w", tsStr, err)
+	}
+	var nsec int64
+	if nsecStr != "" {
+		usec, err := strconv.ParseInt(nsecStr, 10, 64)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("bad fraction in %q: %w", tsStr, err)
+		}
+		nsec = usec * 1000
+	}
+	ts := time.Unix(sec, nsec)
+
+	rest := strings.Fields(line[end+1:])
+	if len(rest) != 2 {
+		return time.Time{}, nil, fmt.Errorf("malformed line: %q", line)
+	}
+
+	idAndData := strings.SplitN(rest[1], "#", 2)
+	if len(idAndData) != 2 {
+		return time.Time{}, nil, fmt.Errorf("malformed id#data: %q", rest[1])
+	}
+
+	id, err := strconv.ParseUint(idAndData[0], 16, 32)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("bad identifier %q: %w", idAndData[0], err)
+	}
+
+	data, err := hexDecode(idAndData[1])
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("bad data %q: %w", idAndData[1], err)
+	}
+
+	return ts, gocan.NewFrame(uint32(id), data, direction), nil
+}
+
+func hexDecode(s string) ([]byte, error) {
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("odd length hex string")
+	}
+	out := make([]byte, len(s)/2)
+	for i := range out {
+		b, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = byte(b)
+	}
+	return out, nil
+}
+
+// newCandumpScanner returns a line-by-line bufio.Scanner over a candump log
+// for the replay adapter.
+func newCandumpScanner(r io.Reader) *bufio.Scanner {
+	return bufio.NewScanner(r)
+}
@@ -5,14 +5,12 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"os"
 	"runtime"
 	"time"
 
 	"github.com/google/gousb"
 	"github.com/roffe/gocan"
-	"github.com/smallnest/ringbuffer"
 )
 
 const (
@@ -54,10 +52,18 @@ type CombiAdapter struct {
 	sendSem    chan struct{}
 }
 
+const (
+	combiVID gousb.ID = 0xFFFF
+	combiPID gousb.ID = 0x0005
+)
+
+// init registers CombiAdapter unconditionally, regardless of whether the
+// device happens to be plugged in at program start. Whether it's actually
+// present is a runtime fact that changes over time (see Watch), not
+// something a one-shot check at init() can answer.
 func init() {
-	if !findCombi() {
-		return
-	}
+	registerUSBIdent(combiVID, combiPID, "CombiAdapter")
+
 	if err := Register(&AdapterInfo{
 		Name:               "CombiAdapter",
 		Description:        "libusb driver",
@@ -73,24 +79,13 @@ func init() {
 	}
 }
 
-func findCombi() bool {
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-	dev, err := ctx.OpenDeviceWithVIDPID(0xFFFF, 0x0005)
-	if err != nil || dev == nil {
-		return false
-	}
-	defer dev.Close()
-	return true
-}
-
 func NewCombi(cfg *gocan.AdapterConfig) (gocan.Adapter, error) {
 	return &CombiAdapter{
 		cfg:     cfg,
 		send:    make(chan gocan.CANFrame, 10),
 		recv:    make(chan gocan.CANFrame, 20),
 		close:   make(chan struct{}, 1),
-		sendSem: make(chan struct{}, 1),
+		sendSem: make(chan struct{}, txInFlight),
 	}, nil
 }
 
@@ -107,7 +102,13 @@ func (ca *CombiAdapter) Init(ctx context.Context) error {
 
 	var err error
 
-	ca.dev, err = ca.usbCtx.OpenDeviceWithVIDPID(0xFFFF, 0x0005)
+	ca.dev, err = ca.usbCtx.OpenDeviceWithVIDPID(combiVID, combiPID)
+	if err == nil && ca.dev == nil {
+		if err := ca.usbCtx.Close(); err != nil {
+			ca.cfg.OnError(fmt.Errorf("failed to close usb context: %w", err))
+		}
+		return ErrAdapterDisconnected
+	}
 	if err != nil && ca.dev == nil {
 		if err := ca.usbCtx.Close(); err != nil {
 			ca.cfg.OnError(fmt.Errorf("failed to close usb context: %w", err))
@@ -185,8 +186,8 @@ func (ca *CombiAdapter) Init(ctx context.Context) error {
 		return err
 	}
 
-	go ca.recvManager()
-	go ca.sendManager()
+	go ca.recvManager(ctx)
+	go ca.sendManager(ctx)
 
 	return nil
 }
@@ -219,25 +220,67 @@ func (ca *CombiAdapter) closeAdapter(sendClose bool) error {
 	return nil
 }
 
-func (ca *CombiAdapter) sendManager() {
+// txInFlight bounds how many frames sendManager may queue ahead of the
+// device; it's backpressure on submission, not a promise that more than one
+// bulk OUT transfer is ever outstanding on the wire (see txWriter).
+const txInFlight = 4
+
+// txContext owns the buffer for a single queued bulk OUT transfer.
+type txContext struct {
+	buf []byte
+}
+
+func (ca *CombiAdapter) sendManager(ctx context.Context) {
 	runtime.LockOSThread()
-	sw, err := ca.out.NewStream(ca.out.Desc.MaxPacketSize, 1)
-	if err != nil {
-		ca.cfg.OnError(fmt.Errorf("failed to create stream writer: %w", err))
-	}
+
+	jobs := make(chan *txContext, txInFlight)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		ca.txWriter(ctx, jobs)
+	}()
+
 	for {
 		select {
 		case <-ca.close:
+			close(jobs)
+			<-writerDone
+			return
+		case <-ctx.Done():
+			close(jobs)
+			<-writerDone
 			return
 		case f := <-ca.send:
-			ca.sendSem <- struct{}{}
-			if _, err := sw.Write(ca.frameToTxBytes(f)); err != nil {
-				ca.cfg.OnError(fmt.Errorf("failed to send frame: %w", err))
+			select {
+			case jobs <- &txContext{buf: ca.frameToTxBytes(f)}:
+			case <-ca.close:
+				close(jobs)
+				<-writerDone
+				return
+			case <-ctx.Done():
+				close(jobs)
+				<-writerDone
+				return
 			}
 		}
 	}
 }
 
+// txWriter is the only goroutine that writes CAN frames to ca.out (the
+// open/close, bitrate and version packets are written elsewhere): jobs may be
+// queued up to txInFlight deep ahead of time, but they're reaped and
+// written strictly in submission order, so a flashing session streaming
+// thousands of sequential frames can't have them reordered by goroutine
+// scheduling.
+func (ca *CombiAdapter) txWriter(ctx context.Context, jobs <-chan *txContext) {
+	for tx := range jobs {
+		ca.sendSem <- struct{}{}
+		if _, err := ca.out.WriteContext(ctx, tx.buf); err != nil {
+			ca.cfg.OnError(fmt.Errorf("failed to send frame: %w", err))
+		}
+	}
+}
+
 func (ca *CombiAdapter) frameToTxBytes(frame gocan.CANFrame) []byte {
 	buff := make([]byte, 19)
 	buff[0] = cmdtxFrame
@@ -295,122 +338,188 @@ func (ca *CombiAdapter) sendFrame(ctx context.Context, frame gocan.CANFrame) err
 }
 */
 
-func (ca *CombiAdapter) recvManager() {
-	f, err := os.Create("recv.log")
+func (ca *CombiAdapter) recvManager(ctx context.Context) {
+	f, err := os.Create("recv.candump")
 	if err != nil {
 		ca.cfg.OnError(fmt.Errorf("failed to create log file: %w", err))
 		return
 	}
+	defer f.Close()
 
-	rb := ringbuffer.New(ca.in.Desc.MaxPacketSize * 10)
-	buff := make([]byte, ca.in.Desc.MaxPacketSize)
-	rs, err := ca.in.NewStream(ca.in.Desc.MaxPacketSize, 8)
-	if err != nil {
-		ca.cfg.OnError(fmt.Errorf("failed to create read stream: %w", err))
-		return
-	}
-	go func() {
-		for {
+	chunks := make(chan []byte, rxInFlight)
+	go ca.rxPump(ctx, chunks)
+
+	cr := newChunkReader(chunks, ca.close, ctx)
+
+	for {
+		cmd, ok := cr.readByte()
+		if !ok {
+			return
+		}
+
+		if cmd == cmdtxFrame {
 			select {
-			case <-ca.close:
-				return
+			case <-ca.sendSem:
 			default:
-				n, err := rs.Read(buff)
-				if err != nil {
-					ca.cfg.OnError(fmt.Errorf("failed to read from usb: %w", err))
-					continue
-				}
-				f.WriteString(fmt.Sprintf("%X", buff[:n]) + "\n")
-				if _, err := rb.Write(buff[:n]); err != nil {
-					ca.cfg.OnError(fmt.Errorf("failed to write to ringbuffer: %w", err))
-					continue
-				}
 			}
 		}
-	}()
 
-	for {
-		select {
-		case <-ca.close:
+		lenBytes, ok := cr.read(2)
+		if !ok {
 			return
-		default:
-			if rb.IsEmpty() {
-				continue
+		}
+		dataLen := int(lenBytes[0])<<8 | int(lenBytes[1])
+
+		data, ok := cr.read(dataLen)
+		if !ok {
+			return
+		}
+
+		term, ok := cr.readByte()
+		if !ok {
+			return
+		}
+
+		switch cmd {
+		case cmdtxFrame, cmdVersion, cmdOpen:
+		case cmdrxFrame: //rx
+			frame := gocan.NewFrame(
+				binary.LittleEndian.Uint32(data[:4]),
+				data[4:4+data[12]],
+				gocan.Incoming,
+			)
+			if err := writeCandumpLine(f, time.Now(), frame); err != nil {
+				ca.cfg.OnError(fmt.Errorf("failed to write candump log: %w", err))
 			}
-			cmd, err := rb.ReadByte()
-			if err != nil {
-				ca.cfg.OnError(fmt.Errorf("failed to read cmd from ringbuffer: %w", err))
-				continue
+			select {
+			case ca.recv <- frame:
+			case <-ca.close:
+				return
+			case <-ctx.Done():
+				return
 			}
+		default:
+			f.WriteString(fmt.Sprintf("cmd: %02X, len: %d, data: %X, term: %02X", cmd, dataLen, data, term) + "\n")
+		}
+	}
+}
 
-			switch cmd {
-			case cmdrxFrame:
-				for rb.Length() < 2 {
-					//log.Println("waiting for rx Data")
-					time.Sleep(ca.in.Desc.PollInterval)
-				}
-			case cmdtxFrame:
-				select {
-				case <-ca.sendSem:
-				default:
-				}
-				for rb.Length() < 3 {
-					log.Println("waiting for tx Data")
-					time.Sleep(ca.in.Desc.PollInterval)
-				}
-			default:
-				for rb.Length() < 3 {
-					log.Printf("waiting for Data for cmd %X", cmd)
-					time.Sleep(ca.in.Desc.PollInterval)
-				}
-			}
+// rxInFlight caps how many bulk IN transfers are submitted to the device at
+// once. Each slot is reaped independently and resubmitted as soon as its
+// data has been delivered to chunks, in order.
+const rxInFlight = 8
 
-			lenBytes := make([]byte, 2)
-			if _, err := rb.Read(lenBytes); err != nil {
-				ca.cfg.OnError(fmt.Errorf("failed to read len from ringbuffer: %w", err))
-			}
-			dataLen := int(lenBytes[0])<<8 | int(lenBytes[1])
+type rxResult struct {
+	seq uint64
+	buf []byte
+}
 
-			if cmd == cmdrxFrame {
-				for rb.Length() < dataLen+1 {
-					//log.Println("waiting for rx2 Data")
-					time.Sleep(ca.in.Desc.PollInterval)
-				}
+// rxPump submits rxInFlight bulk IN transfers and keeps resubmitting as each
+// completes, reordering results by sequence number before handing the
+// reassembled byte stream to chunks. This replaces the old single
+// gousb.Stream reader plus ringbuffer with one buffer per in-flight
+// transfer.
+func (ca *CombiAdapter) rxPump(ctx context.Context, chunks chan<- []byte) {
+	defer close(chunks)
+
+	results := make(chan rxResult, rxInFlight)
+
+	submit := func(seq uint64) {
+		go func() {
+			buf := make([]byte, ca.in.Desc.MaxPacketSize)
+			n, err := ca.in.ReadContext(ctx, buf)
+			if err != nil {
+				ca.cfg.OnError(fmt.Errorf("failed to read from usb: %w", err))
+				results <- rxResult{seq: seq}
+				return
 			}
+			results <- rxResult{seq: seq, buf: buf[:n]}
+		}()
+	}
 
-			//var data []byte
-			data := make([]byte, dataLen)
-			if dataLen > 0 {
-				n, err := rb.Read(data)
-				if err != nil {
-					ca.cfg.OnError(fmt.Errorf("failed to read data from ringbuffer: %w", err))
-				}
-				if n != dataLen {
-					ca.cfg.OnError(fmt.Errorf("read %d bytes, expected %d", n, dataLen))
+	for seq := uint64(0); seq < rxInFlight; seq++ {
+		submit(seq)
+	}
+	nextSubmit := uint64(rxInFlight)
+
+	pending := make(map[uint64]rxResult)
+	next := uint64(0)
+	for {
+		select {
+		case <-ca.close:
+			return
+		case <-ctx.Done():
+			return
+		case res := <-results:
+			pending[res.seq] = res
+			for r, ok := pending[next]; ok; r, ok = pending[next] {
+				delete(pending, next)
+				next++
+				if len(r.buf) > 0 {
+					select {
+					case chunks <- r.buf:
+					case <-ca.close:
+						return
+					case <-ctx.Done():
+						return
+					}
 				}
+				submit(nextSubmit)
+				nextSubmit++
 			}
+		}
+	}
+}
 
-			term, err := rb.ReadByte()
-			if err != nil {
-				ca.cfg.OnError(fmt.Errorf("failed to read term from ringbuffer: %w", err))
-			}
+// chunkReader assembles the byte stream handed over by rxPump's chunks
+// channel into the framed reads recvManager needs (readByte/read), blocking
+// on the channel instead of busy-polling a ringbuffer.
+type chunkReader struct {
+	buf  bytes.Buffer
+	in   <-chan []byte
+	done <-chan struct{}
+	ctx  context.Context
+}
 
-			switch cmd {
+func newChunkReader(in <-chan []byte, done <-chan struct{}, ctx context.Context) *chunkReader {
+	return &chunkReader{in: in, done: done, ctx: ctx}
+}
 
-			case cmdtxFrame, cmdVersion, cmdOpen:
-			case cmdrxFrame: //rx
-				frame := gocan.NewFrame(
-					binary.LittleEndian.Uint32(data[:4]),
-					data[4:4+data[12]],
-					gocan.Incoming,
-				)
-				ca.recv <- frame
-			default:
-				//log.Printf("cmd: %02X, len: %d, data: %X, term: %02X", cmd, dataLen, data, term)
-				f.WriteString(fmt.Sprintf("cmd: %02X, len: %d, data: %X, term: %02X", cmd, dataLen, data, term) + "\n")
+func (c *chunkReader) fill(n int) bool {
+	for c.buf.Len() < n {
+		select {
+		case chunk, ok := <-c.in:
+			if !ok {
+				return false
 			}
+			c.buf.Write(chunk)
+		case <-c.done:
+			return false
+		case <-c.ctx.Done():
+			return false
 		}
 	}
+	return true
+}
+
+func (c *chunkReader) readByte() (byte, bool) {
+	if !c.fill(1) {
+		return 0, false
+	}
+	b, _ := c.buf.ReadByte()
+	return b, true
+}
+
+func (c *chunkReader) read(n int) ([]byte, bool) {
+	if n == 0 {
+		return nil, true
+	}
+	if !c.fill(n) {
+		return nil, false
+	}
+	out := make([]byte, n)
+	c.buf.Read(out)
+	return out, true
 }
 
 func (ca *CombiAdapter) setBitrate(ctx context.Context) error {
@@ -0,0 +1,101 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/roffe/gocan"
+)
+
+// TeeAdapter wraps another gocan.Adapter and mirrors every frame it sends or
+// receives into a candump-format log file, so a live session can be
+// replayed later with LogAdapter.
+type TeeAdapter struct {
+	gocan.Adapter
+	logFile string
+
+	f    *os.File
+	send chan gocan.CANFrame
+	recv chan gocan.CANFrame
+	done chan struct{}
+}
+
+// NewTeeAdapter wraps inner so every frame passing through it is also
+// appended to logFile in candump -L format.
+func NewTeeAdapter(inner gocan.Adapter, logFile string) *TeeAdapter {
+	return &TeeAdapter{
+		Adapter: inner,
+		logFile: logFile,
+		send:    make(chan gocan.CANFrame, 10),
+		recv:    make(chan gocan.CANFrame, 20),
+		done:    make(chan struct{}),
+	}
+}
+
+func (ta *TeeAdapter) Init(ctx context.Context) error {
+	if err := ta.Adapter.Init(ctx); err != nil {
+		return err
+	}
+
+	f, err := os.Create(ta.logFile)
+	if err != nil {
+		return fmt.Errorf("failed to create tee log file: %w", err)
+	}
+	ta.f = f
+
+	go ta.teeRecv()
+	go ta.teeSend()
+
+	return nil
+}
+
+func (ta *TeeAdapter) teeRecv() {
+	inner := ta.Adapter.Recv()
+	for {
+		select {
+		case <-ta.done:
+			return
+		case frame, ok := <-inner:
+			if !ok {
+				return
+			}
+			_ = writeCandumpLine(ta.f, time.Now(), frame)
+			select {
+			case ta.recv <- frame:
+			case <-ta.done:
+				return
+			}
+		}
+	}
+}
+
+func (ta *TeeAdapter) teeSend() {
+	inner := ta.Adapter.Send()
+	for {
+		select {
+		case <-ta.done:
+			return
+		case frame := <-ta.send:
+			_ = writeCandumpLine(ta.f, time.Now(), frame)
+			inner <- frame
+		}
+	}
+}
+
+func (ta *TeeAdapter) Close() error {
+	close(ta.done)
+	if ta.f != nil {
+		ta.f.Close()
+	}
+	return ta.Adapter.Close()
+}
+
+func (ta *TeeAdapter) Recv() <-chan gocan.CANFrame {
+	return ta.recv
+}
+
+func (ta *TeeAdapter) Send() chan<- gocan.CANFrame {
+	return ta.send
+}
@@ -0,0 +1,126 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/gousb"
+)
+
+// pollInterval is how often Watch re-scans attached USB devices. gousb
+// (and the libusb it wraps) has no hotplug callback API, so polling is the
+// only option.
+const pollInterval = 500 * time.Millisecond
+
+// ErrAdapterDisconnected is returned by Init when the underlying USB device
+// is not attached at the time Init opens it, for example because it was
+// unplugged after discovery.
+var ErrAdapterDisconnected = errors.New("adapter: device disconnected")
+
+// AdapterEventType distinguishes the two events emitted by Watch.
+type AdapterEventType int
+
+const (
+	AdapterAttached AdapterEventType = iota
+	AdapterDetached
+)
+
+// AdapterEvent is emitted by Watch whenever a known adapter is plugged in or
+// unplugged.
+type AdapterEvent struct {
+	Type AdapterEventType
+	Info *AdapterInfo
+}
+
+// usbIdent pairs a VID/PID with the AdapterInfo name it identifies.
+type usbIdent struct {
+	vid, pid gousb.ID
+	name     string
+}
+
+// knownDevices lists the VID/PID pairs Watch recognizes. CombiAdapter
+// registers itself here from its init().
+var knownDevices []usbIdent
+
+// registerUSBIdent is called by adapter implementations that want hotplug
+// discovery in addition to their Register() call.
+func registerUSBIdent(vid, pid gousb.ID, name string) {
+	knownDevices = append(knownDevices, usbIdent{vid: vid, pid: pid, name: name})
+}
+
+// Watch returns a channel of AdapterEvents for any known adapter being
+// attached or detached, discovered by polling every pollInterval. The
+// channel is closed when ctx is canceled.
+func Watch(ctx context.Context) <-chan AdapterEvent {
+	out := make(chan AdapterEvent)
+	go watchLoop(ctx, out)
+	return out
+}
+
+func watchLoop(ctx context.Context, out chan<- AdapterEvent) {
+	defer close(out)
+
+	usbCtx := gousb.NewContext()
+	defer usbCtx.Close()
+
+	present := make(map[usbIdent]bool)
+
+	emit := func(ev AdapterEvent) bool {
+		select {
+		case out <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	poll := func() bool {
+		seen := make(map[usbIdent]bool)
+		devs, _ := usbCtx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+			for _, id := range knownDevices {
+				if desc.Vendor == id.vid && desc.Product == id.pid {
+					seen[id] = true
+				}
+			}
+			return false
+		})
+		for _, d := range devs {
+			d.Close()
+		}
+
+		for _, id := range knownDevices {
+			switch {
+			case seen[id] && !present[id]:
+				present[id] = true
+				if !emit(AdapterEvent{Type: AdapterAttached, Info: registry[id.name]}) {
+					return false
+				}
+			case !seen[id] && present[id]:
+				present[id] = false
+				if !emit(AdapterEvent{Type: AdapterDetached, Info: registry[id.name]}) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	if !poll() {
+		return
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !poll() {
+				return
+			}
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
+	"github.com/roffe/gocan/pkg/model"
 	"github.com/roffe/gocan/pkg/t5"
 	"github.com/spf13/cobra"
 )
 
+var t5flashResume bool
+
 var t5flashCmd = &cobra.Command{
 	Use:   "flash <filename>",
 	Short: "flash ECU",
@@ -20,6 +24,16 @@ var t5flashCmd = &cobra.Command{
 		defer c.Close()
 
 		tr := t5.New(c)
+		tr.OnProgress = func(v interface{}) {
+			p, ok := v.(*model.FlashProgress)
+			if !ok {
+				return
+			}
+			fmt.Printf("\r%s: sector %d/%d (%d/%d bytes) elapsed %s ETA %s", p.Op, p.Sector, p.Sectors, p.Bytes, p.Total, p.Elapsed.Round(1e6), p.ETA.Round(1e6))
+			if p.Sector == p.Sectors {
+				fmt.Println()
+			}
+		}
 
 		bin, err := os.ReadFile(args[0])
 		if err != nil {
@@ -35,7 +49,11 @@ var t5flashCmd = &cobra.Command{
 			return err
 		}
 
-		if err := tr.FlashECU(ctx, ecutype, bin); err != nil {
+		if err := tr.FlashECU(ctx, ecutype, bin, t5flashResume); err != nil {
+			return err
+		}
+
+		if err := tr.VerifyECU(ctx, bin); err != nil {
 			return err
 		}
 
@@ -48,5 +66,6 @@ var t5flashCmd = &cobra.Command{
 }
 
 func init() {
+	t5flashCmd.Flags().BoolVar(&t5flashResume, "resume", false, "skip sectors that already match the file on the ECU")
 	t5Cmd.AddCommand(t5flashCmd)
-}
\ No newline at end of file
+}
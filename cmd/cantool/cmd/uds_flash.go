@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/roffe/gocan/pkg/isotp"
+	"github.com/roffe/gocan/pkg/uds"
+	"github.com/spf13/cobra"
+)
+
+const (
+	udsReqID  = 0x7E0
+	udsRespID = 0x7E8
+
+	udsDownloadAddr = 0x000000
+)
+
+var udsKeyAlgo string
+
+var udsCmd = &cobra.Command{
+	Use:   "uds",
+	Short: "ISO 14229 (UDS) diagnostics",
+}
+
+var udsflashCmd = &cobra.Command{
+	Use:   "flash <filename>",
+	Short: "flash ECU over UDS",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		c, err := initCAN(ctx, udsReqID)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		keyFromSeed, ok := uds.KeyAlgorithm(udsKeyAlgo)
+		if !ok {
+			return fmt.Errorf("no key algorithm registered for %q", udsKeyAlgo)
+		}
+
+		conn := isotp.NewConn(ctx, c, isotp.DefaultConfig(udsReqID, udsRespID))
+		uc := uds.NewClient(conn)
+
+		bin, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := runUDSFlash(uc, bin, keyFromSeed); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+// runUDSFlash drives the session-control/security-access/download/transfer
+// sequence to flash bin onto the ECU, giving T8/E39 users the same one-shot
+// flash UX t5flashCmd offers for Trionic 5.
+func runUDSFlash(uc *uds.Client, bin []byte, keyFromSeed uds.KeyFromSeed) error {
+	if err := uc.DiagnosticSessionControl(uds.SessionProgramming); err != nil {
+		return fmt.Errorf("failed to enter programming session: %w", err)
+	}
+
+	if err := uc.SecurityAccess(0x01, keyFromSeed); err != nil {
+		return fmt.Errorf("security access denied: %w", err)
+	}
+
+	maxBlockLen, err := uc.RequestDownload(udsDownloadAddr, uint32(len(bin)), 0x00)
+	if err != nil {
+		return fmt.Errorf("request download rejected: %w", err)
+	}
+	if maxBlockLen <= 2 {
+		return fmt.Errorf("ECU reported an unusable max block length of %d", maxBlockLen)
+	}
+
+	chunkSize := maxBlockLen - 2 // transferData header is blockSeq + sid
+	blockSeq := byte(1)
+	for off := 0; off < len(bin); off += chunkSize {
+		end := off + chunkSize
+		if end > len(bin) {
+			end = len(bin)
+		}
+		if err := uc.TransferData(blockSeq, bin[off:end]); err != nil {
+			return fmt.Errorf("transfer data failed at offset 0x%06X: %w", off, err)
+		}
+		blockSeq++
+	}
+
+	if err := uc.RequestTransferExit(); err != nil {
+		return fmt.Errorf("request transfer exit failed: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	udsflashCmd.Flags().StringVar(&udsKeyAlgo, "algo", "", "seed/key algorithm registered via uds.RegisterKeyAlgorithm to use for SecurityAccess")
+	udsflashCmd.MarkFlagRequired("algo")
+	udsCmd.AddCommand(udsflashCmd)
+	rootCmd.AddCommand(udsCmd)
+}
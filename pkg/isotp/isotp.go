@@ -0,0 +1,381 @@
+// Package isotp implements ISO 15765-2 (ISO-TP) segmentation and
+// reassembly on top of gocan.CANFrame, letting callers exchange payloads
+// larger than a single CAN frame (e.g. UDS requests/responses) over a
+// gocan.Adapter.
+package isotp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/roffe/gocan"
+)
+
+// PCI (protocol control information) frame types, ISO 15765-2 table 2.
+const (
+	pciSingle      = 0x0
+	pciFirst       = 0x1
+	pciConsecutive = 0x2
+	pciFlowControl = 0x3
+
+	fcContinue = 0x0
+	fcWait     = 0x1
+	fcOverflow = 0x2
+)
+
+// Errors returned by Conn.
+var (
+	// ErrTimeout is returned when a consecutive frame or flow control
+	// frame doesn't arrive within the configured N_Bs/N_Cr window.
+	ErrTimeout = errors.New("isotp: timeout waiting for frame")
+	// ErrOverflow is returned when the peer responds to a flow control
+	// request with FC.Overflow.
+	ErrOverflow = errors.New("isotp: flow control overflow")
+	// ErrSequence is returned when a consecutive frame arrives with an
+	// unexpected sequence number.
+	ErrSequence = errors.New("isotp: unexpected consecutive frame sequence number")
+	// ErrTooLarge is returned by Write when the payload doesn't fit in
+	// the 12-bit ISO-TP length field (4095 bytes).
+	ErrTooLarge = errors.New("isotp: payload too large")
+)
+
+const maxLength = 0xFFF // 12-bit length field used by first frames
+
+// Config describes one ISO-TP endpoint pairing: the CAN ID frames are sent
+// on and the CAN ID replies are expected on.
+type Config struct {
+	TxID uint32
+	RxID uint32
+
+	// Extended selects the one-byte extended addressing mode, where the
+	// first payload byte of every frame is the target address extension.
+	Extended      bool
+	TargetAddress uint8
+
+	// STmin is the separation time the peer should wait between the
+	// consecutive frames it sends us, encoded in the flow control frame we
+	// send.
+	STmin time.Duration
+	// BlockSize is the number of consecutive frames the peer may send us
+	// before waiting for another flow control frame. 0 means unlimited.
+	BlockSize uint8
+
+	// PadFrames, if true, pads frames shorter than 8 bytes with Padding.
+	PadFrames bool
+	Padding   byte
+
+	// N_Bs is how long Write waits for a flow control frame, and N_Cr is
+	// how long Read waits for each consecutive frame.
+	N_Bs time.Duration
+	N_Cr time.Duration
+}
+
+// DefaultConfig returns a Config with the timeouts and flow control
+// parameters ISO 15765-2 recommends as defaults.
+func DefaultConfig(txID, rxID uint32) Config {
+	return Config{
+		TxID:      txID,
+		RxID:      rxID,
+		STmin:     0,
+		BlockSize: 0,
+		PadFrames: true,
+		Padding:   0xAA,
+		N_Bs:      1 * time.Second,
+		N_Cr:      1 * time.Second,
+	}
+}
+
+// Conn is a single ISO-TP connection layered on a gocan.Adapter. Write
+// segments and sends exactly one message per call; Read receives and
+// reassembles exactly one message per call.
+type Conn struct {
+	ctx context.Context
+	cfg Config
+	a   gocan.Adapter
+}
+
+// NewConn creates a Conn bound to ctx that sends on cfg.TxID and expects
+// frames back on cfg.RxID. ctx governs every Read/Write call; cancel it to
+// abort an in-progress transfer.
+func NewConn(ctx context.Context, a gocan.Adapter, cfg Config) *Conn {
+	return &Conn{ctx: ctx, cfg: cfg, a: a}
+}
+
+func (c *Conn) addrOffset() int {
+	if c.cfg.Extended {
+		return 1
+	}
+	return 0
+}
+
+func (c *Conn) frame(payload []byte) gocan.CANFrame {
+	off := c.addrOffset()
+	buf := make([]byte, off+len(payload))
+	if c.cfg.Extended {
+		buf[0] = c.cfg.TargetAddress
+	}
+	copy(buf[off:], payload)
+	if c.cfg.PadFrames && len(buf) < 8 {
+		padded := make([]byte, 8)
+		copy(padded, buf)
+		for i := len(buf); i < 8; i++ {
+			padded[i] = c.cfg.Padding
+		}
+		buf = padded
+	}
+	return gocan.NewFrame(c.cfg.TxID, buf, gocan.Outgoing)
+}
+
+// Write segments p into Single/First/Consecutive frames, driving the flow
+// control handshake as needed, and blocks until the whole message has been
+// sent. It always either sends all of p or returns an error.
+func (c *Conn) Write(p []byte) (n int, err error) {
+	if len(p) > maxLength {
+		return 0, ErrTooLarge
+	}
+
+	off := c.addrOffset()
+	maxSingle := 7 - off
+
+	if len(p) <= maxSingle {
+		payload := make([]byte, 1+len(p))
+		payload[0] = byte(pciSingle<<4) | byte(len(p))
+		copy(payload[1:], p)
+		if err := c.send(payload); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	maxFirst := 6 - off
+	payload := make([]byte, 2+maxFirst)
+	payload[0] = byte(pciFirst<<4) | byte((len(p)>>8)&0xF)
+	payload[1] = byte(len(p) & 0xFF)
+	copy(payload[2:], p[:maxFirst])
+	if err := c.send(payload); err != nil {
+		return 0, err
+	}
+
+	bs, stmin, err := c.waitFlowControl()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := maxFirst
+	seq := uint8(1)
+	sinceFC := uint8(0)
+	maxCF := 7 - off
+	for sent < len(p) {
+		if bs != 0 && sinceFC == bs {
+			bs, stmin, err = c.waitFlowControl()
+			if err != nil {
+				return sent, err
+			}
+			sinceFC = 0
+		}
+
+		end := sent + maxCF
+		if end > len(p) {
+			end = len(p)
+		}
+		cf := make([]byte, 1+(end-sent))
+		cf[0] = byte(pciConsecutive<<4) | byte(seq&0xF)
+		copy(cf[1:], p[sent:end])
+		if err := c.send(cf); err != nil {
+			return sent, err
+		}
+
+		sent = end
+		seq = (seq + 1) % 16
+		sinceFC++
+		if stmin > 0 {
+			time.Sleep(stmin)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *Conn) send(payload []byte) error {
+	select {
+	case c.a.Send() <- c.frame(payload):
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// waitFlowControl waits for the peer's flow control frame, retrying on
+// FC.Wait and returning ErrOverflow on FC.Overflow. The N_Bs deadline is
+// fixed for as long as the peer sends us anything other than a flow control
+// frame, so garbage traffic on RxID can't stall it indefinitely; FC.Wait
+// legitimately restarts the window, since it's the peer asking for more
+// time.
+func (c *Conn) waitFlowControl() (blockSize uint8, stmin time.Duration, err error) {
+	deadline := time.Now().Add(c.cfg.N_Bs)
+	for {
+		frame, err := c.nextFrame(deadline)
+		if err != nil {
+			return 0, 0, err
+		}
+		d := frame.Data()[c.addrOffset():]
+		if len(d) < 3 || d[0]>>4 != pciFlowControl {
+			continue
+		}
+		switch d[0] & 0xF {
+		case fcContinue:
+			return d[1], decodeSTmin(d[2]), nil
+		case fcWait:
+			deadline = time.Now().Add(c.cfg.N_Bs)
+			continue
+		case fcOverflow:
+			return 0, 0, ErrOverflow
+		default:
+			continue
+		}
+	}
+}
+
+// Read waits for and reassembles one complete ISO-TP message into p,
+// sending flow control frames as needed and enforcing N_Cr between
+// consecutive frames. It returns an error if p is too small to hold the
+// reassembled message.
+func (c *Conn) Read(p []byte) (n int, err error) {
+	off := c.addrOffset()
+
+	first, err := c.nextFrame(time.Now().Add(c.cfg.N_Cr))
+	if err != nil {
+		return 0, err
+	}
+	d := first.Data()[off:]
+	if len(d) == 0 {
+		return 0, fmt.Errorf("isotp: empty frame")
+	}
+
+	switch d[0] >> 4 {
+	case pciSingle:
+		sz := int(d[0] & 0xF)
+		if sz > len(d)-1 {
+			return 0, fmt.Errorf("isotp: single frame length %d exceeds payload", sz)
+		}
+		if sz > len(p) {
+			return 0, fmt.Errorf("isotp: %d byte message does not fit in %d byte buffer", sz, len(p))
+		}
+		return copy(p, d[1:1+sz]), nil
+
+	case pciFirst:
+		if len(d) < 2 {
+			return 0, fmt.Errorf("isotp: truncated first frame")
+		}
+		total := int(d[0]&0xF)<<8 | int(d[1])
+		if total > len(p) {
+			return 0, fmt.Errorf("isotp: %d byte message does not fit in %d byte buffer", total, len(p))
+		}
+		n = copy(p, d[2:])
+
+		if err := c.sendFlowControl(); err != nil {
+			return n, err
+		}
+
+		seq := uint8(1)
+		sinceFC := uint8(0)
+		deadline := time.Now().Add(c.cfg.N_Cr)
+		for n < total {
+			cf, err := c.nextFrame(deadline)
+			if err != nil {
+				return n, err
+			}
+			cd := cf.Data()[off:]
+			if len(cd) == 0 || cd[0]>>4 != pciConsecutive {
+				continue
+			}
+			if cd[0]&0xF != seq&0xF {
+				return n, ErrSequence
+			}
+			n += copy(p[n:total], cd[1:])
+			seq = (seq + 1) % 16
+			sinceFC++
+			if c.cfg.BlockSize != 0 && sinceFC == c.cfg.BlockSize && n < total {
+				if err := c.sendFlowControl(); err != nil {
+					return n, err
+				}
+				sinceFC = 0
+			}
+			deadline = time.Now().Add(c.cfg.N_Cr)
+		}
+		return n, nil
+
+	default:
+		return 0, fmt.Errorf("isotp: unexpected PCI type %#x", d[0]>>4)
+	}
+}
+
+func (c *Conn) sendFlowControl() error {
+	off := c.addrOffset()
+	fc := make([]byte, 3+off)
+	if c.cfg.Extended {
+		fc[0] = c.cfg.TargetAddress
+	}
+	fc[off] = byte(pciFlowControl<<4) | fcContinue
+	fc[off+1] = c.cfg.BlockSize
+	fc[off+2] = encodeSTmin(c.cfg.STmin)
+	return c.send(fc)
+}
+
+// nextFrame waits for the next frame on RxID, returning ErrTimeout once
+// deadline passes. Callers that retry on non-matching frames (wrong PCI
+// type, malformed flow control, ...) must reuse the same deadline across
+// retries rather than computing a fresh one each call, or unrelated traffic
+// can stall them indefinitely.
+func (c *Conn) nextFrame(deadline time.Time) (gocan.CANFrame, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	for {
+		select {
+		case frame := <-c.a.Recv():
+			if frame.Identifier() != c.cfg.RxID {
+				continue
+			}
+			return frame, nil
+		case <-timer.C:
+			return nil, ErrTimeout
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		}
+	}
+}
+
+// encodeSTmin encodes d (0-127ms in 1ms steps, or 100-900us in 100us steps)
+// into the ISO-TP STmin byte. Values inside a range are truncated to its
+// step; values below 100us encode as 0, values between 900us and 1ms as
+// 900us, and values above 127ms as 127ms.
+func encodeSTmin(d time.Duration) byte {
+	switch {
+	case d <= 0:
+		return 0x00
+	case d < 100*time.Microsecond:
+		return 0x00
+	case d <= 900*time.Microsecond:
+		return byte(0xF0 | (d / (100 * time.Microsecond)))
+	case d < time.Millisecond:
+		return 0xF9
+	case d <= 127*time.Millisecond:
+		return byte(d / time.Millisecond)
+	default:
+		return 0x7F
+	}
+}
+
+// decodeSTmin is the inverse of encodeSTmin.
+func decodeSTmin(b byte) time.Duration {
+	switch {
+	case b <= 0x7F:
+		return time.Duration(b) * time.Millisecond
+	case b >= 0xF1 && b <= 0xF9:
+		return time.Duration(b&0xF) * 100 * time.Microsecond
+	default:
+		return 0
+	}
+}
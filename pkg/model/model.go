@@ -1,7 +1,22 @@
 package model
 
+import "time"
+
 type ProgressCallback func(interface{})
 
+// FlashProgress is reported through a ProgressCallback by ECU flashing
+// routines (identify, erase, flash, verify). Flash and verify report once per
+// sector; identify and erase each count as a single step.
+type FlashProgress struct {
+	Op      string // "identify", "erase", "flash" or "verify"
+	Sector  int
+	Sectors int
+	Bytes   int
+	Total   int
+	Elapsed time.Duration
+	ETA     time.Duration
+}
+
 type Header struct {
 	Desc string
 	ID   uint8
@@ -14,4 +29,4 @@ type HeaderResult struct {
 
 func (t *HeaderResult) String() string {
 	return t.Desc + ": " + t.Value
-}
\ No newline at end of file
+}
@@ -0,0 +1,334 @@
+// Package t5 implements the flash/erase/reset sequence used to talk to a
+// Saab Trionic 5 ECU over CAN.
+package t5
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"time"
+
+	"github.com/roffe/gocan"
+	"github.com/roffe/gocan/pkg/model"
+)
+
+// ECUType identifies the Trionic 5 variant returned by DetermineECU. Flash
+// layout (size, sector count) differs between them.
+type ECUType int
+
+const (
+	ECUUnknown ECUType = iota
+	ECUT55
+	ECUT55L
+	ECUT52
+)
+
+func (e ECUType) String() string {
+	switch e {
+	case ECUT55:
+		return "Trionic 5.5"
+	case ECUT55L:
+		return "Trionic 5.5 (Lucas)"
+	case ECUT52:
+		return "Trionic 5.2"
+	default:
+		return "unknown"
+	}
+}
+
+// sectorSize is the granularity at which FlashECU writes and VerifyECU reads
+// back the ECU flash. It also doubles as the resume checkpoint size.
+const sectorSize = 0x400
+
+// Trionic 5's legacy diagnostic protocol talks directly over raw CAN
+// frames (no ISO-TP segmentation): every request goes out on t5RequestID
+// and the ECU answers on t5ResponseID.
+const (
+	t5RequestID  = 0x11
+	t5ResponseID = 0x06
+
+	t5CmdIdent       = 0xC1
+	t5CmdReadMemory  = 0xC2
+	t5CmdWriteMemory = 0xC3
+	t5CmdErase       = 0xC4
+	t5CmdReset       = 0xC5
+)
+
+// t5ResponseTimeout bounds how long request waits for the ECU to answer a
+// single command frame.
+const t5ResponseTimeout = 2 * time.Second
+
+// t5ChunkSize is the number of payload bytes carried by a single
+// read/write-memory request, leaving room for the command byte and 3-byte
+// address in an 8-byte CAN frame.
+const t5ChunkSize = 4
+
+// request sends payload as a single CAN frame on t5RequestID and returns the
+// data of the next frame the ECU answers with on t5ResponseID.
+func (t *Client) request(ctx context.Context, payload []byte) ([]byte, error) {
+	select {
+	case t.c.Send() <- gocan.NewFrame(t5RequestID, payload, gocan.Outgoing):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	timer := time.NewTimer(t5ResponseTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case frame := <-t.c.Recv():
+			if frame.Identifier() != t5ResponseID {
+				continue
+			}
+			return frame.Data(), nil
+		case <-timer.C:
+			return nil, fmt.Errorf("t5: timeout waiting for response to command %#02x", payload[0])
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Client drives a Trionic 5 flash session over a gocan.Adapter.
+type Client struct {
+	c gocan.Adapter
+
+	// OnProgress, if set, is called once per sector during FlashECU and
+	// VerifyECU, and at the start and end of DetermineECU and EraseECU.
+	OnProgress model.ProgressCallback
+}
+
+// New creates a Client bound to an already-initialized adapter.
+func New(c gocan.Adapter) *Client {
+	return &Client{c: c}
+}
+
+func (t *Client) report(op string, sector, total int, start time.Time) {
+	if t.OnProgress == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	var eta time.Duration
+	if sector > 0 {
+		eta = elapsed / time.Duration(sector) * time.Duration(total-sector)
+	}
+	t.OnProgress(&model.FlashProgress{
+		Op:      op,
+		Sector:  sector,
+		Sectors: total,
+		Bytes:   sector * sectorSize,
+		Total:   total * sectorSize,
+		Elapsed: elapsed,
+		ETA:     eta,
+	})
+}
+
+// DetermineECU probes the ECU and reports which Trionic 5 variant answered.
+func (t *Client) DetermineECU(ctx context.Context) (ECUType, error) {
+	start := time.Now()
+	t.report("identify", 0, 1, start)
+
+	if err := t.c.SetFilter(nil); err != nil {
+		return ECUUnknown, fmt.Errorf("failed to set filter: %w", err)
+	}
+
+	resp, err := t.request(ctx, []byte{t5CmdIdent})
+	if err != nil {
+		return ECUUnknown, fmt.Errorf("failed to identify ECU: %w", err)
+	}
+	if len(resp) == 0 {
+		return ECUUnknown, fmt.Errorf("t5: empty identify response")
+	}
+
+	t.report("identify", 1, 1, start)
+
+	switch resp[0] {
+	case 0x01:
+		return ECUT55, nil
+	case 0x02:
+		return ECUT55L, nil
+	case 0x03:
+		return ECUT52, nil
+	default:
+		return ECUUnknown, fmt.Errorf("t5: unrecognized ECU identifier %#02x", resp[0])
+	}
+}
+
+// EraseECU erases the ECU flash prior to programming. The whole flash is
+// erased by a single command, which OnProgress sees as one step reported at
+// its start and end.
+func (t *Client) EraseECU(ctx context.Context) error {
+	start := time.Now()
+	sectors := 1
+	t.report("erase", 0, sectors, start)
+
+	resp, err := t.request(ctx, []byte{t5CmdErase})
+	if err != nil {
+		return fmt.Errorf("failed to erase ECU: %w", err)
+	}
+	if len(resp) == 0 || resp[0] != 0x00 {
+		return fmt.Errorf("t5: erase command rejected")
+	}
+
+	t.report("erase", sectors, sectors, start)
+	return nil
+}
+
+// resumeState tracks, per sector, whether the ECU already holds the bytes we
+// were about to write so --resume can skip them.
+type resumeState struct {
+	enabled bool
+	hashes  [][20]byte
+}
+
+func newResumeState(bin []byte, enabled bool) *resumeState {
+	rs := &resumeState{enabled: enabled}
+	if !enabled {
+		return rs
+	}
+	for off := 0; off < len(bin); off += sectorSize {
+		end := off + sectorSize
+		if end > len(bin) {
+			end = len(bin)
+		}
+		rs.hashes = append(rs.hashes, sha1.Sum(bin[off:end]))
+	}
+	return rs
+}
+
+// matches reports whether the sector at data already equals the expected
+// sector hash, meaning it can be skipped during a resumed flash.
+func (rs *resumeState) matches(sector int, data []byte) bool {
+	if !rs.enabled || sector >= len(rs.hashes) {
+		return false
+	}
+	return sha1.Sum(data) == rs.hashes[sector]
+}
+
+// FlashECU programs bin onto the ECU. When resume is true, sectors whose
+// on-ECU contents already hash to the corresponding sector of bin are
+// skipped, allowing an interrupted flash to continue where it left off.
+func (t *Client) FlashECU(ctx context.Context, ecuType ECUType, bin []byte, resume bool) error {
+	rs := newResumeState(bin, resume)
+	sectors := (len(bin) + sectorSize - 1) / sectorSize
+	start := time.Now()
+
+	for sector := 0; sector < sectors; sector++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		off := sector * sectorSize
+		end := off + sectorSize
+		if end > len(bin) {
+			end = len(bin)
+		}
+		chunk := bin[off:end]
+
+		if rs.enabled {
+			onECU, err := t.readSector(ctx, off, len(chunk))
+			if err == nil && rs.matches(sector, onECU) {
+				t.report("flash", sector+1, sectors, start)
+				continue
+			}
+		}
+
+		if err := t.writeSector(ctx, off, chunk); err != nil {
+			return fmt.Errorf("failed to write sector %d/%d: %w", sector+1, sectors, err)
+		}
+		t.report("flash", sector+1, sectors, start)
+	}
+	return nil
+}
+
+// VerifyECU reads back the ECU flash and compares it against bin, returning
+// an error naming the first mismatching sector.
+func (t *Client) VerifyECU(ctx context.Context, bin []byte) error {
+	sectors := (len(bin) + sectorSize - 1) / sectorSize
+	start := time.Now()
+
+	for sector := 0; sector < sectors; sector++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		off := sector * sectorSize
+		end := off + sectorSize
+		if end > len(bin) {
+			end = len(bin)
+		}
+
+		onECU, err := t.readSector(ctx, off, end-off)
+		if err != nil {
+			return fmt.Errorf("failed to read back sector %d/%d: %w", sector+1, sectors, err)
+		}
+		if !bytes.Equal(onECU, bin[off:end]) {
+			return fmt.Errorf("verify mismatch in sector %d/%d at offset 0x%06X", sector+1, sectors, off)
+		}
+		t.report("verify", sector+1, sectors, start)
+	}
+	return nil
+}
+
+// ResetECU issues the reset command that restarts the ECU after flashing.
+func (t *Client) ResetECU(ctx context.Context) error {
+	if _, err := t.request(ctx, []byte{t5CmdReset}); err != nil {
+		return fmt.Errorf("failed to reset ECU: %w", err)
+	}
+	return nil
+}
+
+// readSector reads length bytes starting at offset off the ECU, issuing one
+// read-memory-by-address request per t5ChunkSize-sized piece.
+func (t *Client) readSector(ctx context.Context, offset, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		addr := offset + len(out)
+		n := t5ChunkSize
+		if remaining := length - len(out); n > remaining {
+			n = remaining
+		}
+
+		req := []byte{t5CmdReadMemory, byte(addr >> 16), byte(addr >> 8), byte(addr), byte(n)}
+		resp, err := t.request(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read memory at 0x%06X: %w", addr, err)
+		}
+		if len(resp) < n {
+			return nil, fmt.Errorf("t5: short read response at 0x%06X: got %d of %d bytes", addr, len(resp), n)
+		}
+		out = append(out, resp[:n]...)
+	}
+	return out, nil
+}
+
+// writeSector programs data onto the ECU starting at offset, issuing one
+// program-memory request per t5ChunkSize-sized piece.
+func (t *Client) writeSector(ctx context.Context, offset int, data []byte) error {
+	for sent := 0; sent < len(data); {
+		addr := offset + sent
+		n := t5ChunkSize
+		if remaining := len(data) - sent; n > remaining {
+			n = remaining
+		}
+
+		req := make([]byte, 4+n)
+		req[0] = t5CmdWriteMemory
+		req[1] = byte(addr >> 16)
+		req[2] = byte(addr >> 8)
+		req[3] = byte(addr)
+		copy(req[4:], data[sent:sent+n])
+
+		resp, err := t.request(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to write memory at 0x%06X: %w", addr, err)
+		}
+		if len(resp) == 0 || resp[0] != 0x00 {
+			return fmt.Errorf("t5: write rejected at 0x%06X", addr)
+		}
+		sent += n
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package uds implements a minimal ISO 14229 (UDS) client over pkg/isotp,
+// covering the services needed to flash an ECU: session control, security
+// access, and the download/transfer/routine-control trio.
+package uds
+
+import (
+	"fmt"
+
+	"github.com/roffe/gocan/pkg/isotp"
+)
+
+// Service IDs used by Client.
+const (
+	sidDiagnosticSessionControl = 0x10
+	sidSecurityAccess           = 0x27
+	sidRequestDownload          = 0x34
+	sidTransferData             = 0x36
+	sidRequestTransferExit      = 0x37
+	sidRoutineControl           = 0x31
+
+	sidNegativeResponse = 0x7F
+)
+
+// Diagnostic session types for DiagnosticSessionControl.
+const (
+	SessionDefault     = 0x01
+	SessionProgramming = 0x02
+	SessionExtended    = 0x03
+)
+
+// Routine control sub-functions for RoutineControl.
+const (
+	RoutineStart   = 0x01
+	RoutineStop    = 0x02
+	RoutineResults = 0x03
+)
+
+// negative response codes we give a name to in NegativeResponseError.Error.
+var nrcNames = map[byte]string{
+	0x10: "generalReject",
+	0x11: "serviceNotSupported",
+	0x12: "subFunctionNotSupported",
+	0x13: "incorrectMessageLengthOrInvalidFormat",
+	0x22: "conditionsNotCorrect",
+	0x24: "requestSequenceError",
+	0x31: "requestOutOfRange",
+	0x33: "securityAccessDenied",
+	0x35: "invalidKey",
+	0x36: "exceedNumberOfAttempts",
+	0x37: "requiredTimeDelayNotExpired",
+	0x78: "requestCorrectlyReceived-ResponsePending",
+}
+
+// NegativeResponseError is returned when the ECU answers with a 0x7F
+// negative response (0x7F <ServiceID> <NRC>).
+type NegativeResponseError struct {
+	ServiceID byte
+	NRC       byte
+}
+
+func (e *NegativeResponseError) Error() string {
+	name, ok := nrcNames[e.NRC]
+	if !ok {
+		name = "unknown"
+	}
+	return fmt.Sprintf("uds: negative response to service %#02x: NRC %#02x (%s)", e.ServiceID, e.NRC, name)
+}
+
+// KeyFromSeed computes a SecurityAccess key from the seed the ECU returned.
+// Callers register the algorithm matching their ECU family.
+type KeyFromSeed func(seed []byte) []byte
+
+var keyAlgorithms = map[string]KeyFromSeed{}
+
+// RegisterKeyAlgorithm makes a named KeyFromSeed algorithm available to
+// KeyAlgorithm. It's meant to be called from an init() in a file providing a
+// Trionic-family (or other ECU family) seed/key algorithm.
+func RegisterKeyAlgorithm(name string, fn KeyFromSeed) {
+	keyAlgorithms[name] = fn
+}
+
+// KeyAlgorithm looks up a KeyFromSeed algorithm registered via
+// RegisterKeyAlgorithm.
+func KeyAlgorithm(name string) (KeyFromSeed, bool) {
+	fn, ok := keyAlgorithms[name]
+	return fn, ok
+}
+
+// Client is a UDS client layered on an ISO-TP connection. Cancellation is
+// governed by the context conn was created with (see isotp.NewConn); Client's
+// methods take no context of their own since conn.Read/conn.Write don't
+// accept a per-call one.
+type Client struct {
+	conn *isotp.Conn
+	buf  []byte
+}
+
+// NewClient creates a Client that sends/receives UDS messages over conn.
+func NewClient(conn *isotp.Conn) *Client {
+	return &Client{conn: conn, buf: make([]byte, 4096)}
+}
+
+// request sends req and returns the positive response payload (with the
+// echoed service ID already stripped off), or a *NegativeResponseError.
+func (c *Client) request(req []byte) ([]byte, error) {
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, fmt.Errorf("uds: failed to send request: %w", err)
+	}
+
+	for {
+		n, err := c.conn.Read(c.buf)
+		if err != nil {
+			return nil, fmt.Errorf("uds: failed to read response: %w", err)
+		}
+		resp := c.buf[:n]
+		if len(resp) == 0 {
+			return nil, fmt.Errorf("uds: empty response")
+		}
+
+		if resp[0] == sidNegativeResponse {
+			if len(resp) < 3 {
+				return nil, fmt.Errorf("uds: malformed negative response")
+			}
+			nrc := resp[2]
+			if nrc == 0x78 {
+				// requestCorrectlyReceived-ResponsePending: keep waiting.
+				continue
+			}
+			return nil, &NegativeResponseError{ServiceID: resp[1], NRC: nrc}
+		}
+
+		if resp[0] != req[0]+0x40 {
+			return nil, fmt.Errorf("uds: unexpected response service ID %#02x", resp[0])
+		}
+		return resp[1:], nil
+	}
+}
+
+// DiagnosticSessionControl (0x10) switches the ECU into the given session.
+func (c *Client) DiagnosticSessionControl(session byte) error {
+	_, err := c.request([]byte{sidDiagnosticSessionControl, session})
+	return err
+}
+
+// SecurityAccess (0x27) runs the seed/key handshake for level, calling
+// keyFromSeed to compute the key from the ECU-provided seed.
+func (c *Client) SecurityAccess(level byte, keyFromSeed KeyFromSeed) error {
+	seedResp, err := c.request([]byte{sidSecurityAccess, level})
+	if err != nil {
+		return err
+	}
+	if len(seedResp) == 0 {
+		return fmt.Errorf("uds: malformed SecurityAccess response: missing seed")
+	}
+	seed := seedResp[1:]
+
+	// A zero-length seed means the ECU is already unlocked at this level;
+	// per ISO 14229 no key frame should be sent in that case.
+	if len(seed) == 0 {
+		return nil
+	}
+
+	if keyFromSeed == nil {
+		return fmt.Errorf("uds: no key algorithm provided for security access level %#02x", level)
+	}
+
+	key := keyFromSeed(seed)
+	req := append([]byte{sidSecurityAccess, level + 1}, key...)
+	_, err = c.request(req)
+	return err
+}
+
+// RequestDownload (0x34) announces an upcoming TransferData sequence of
+// length size to address addr, and returns the ECU's maxNumberOfBlockLength:
+// the longest TransferData request it accepts, counting the service ID and
+// block sequence counter as well as the data bytes.
+func (c *Client) RequestDownload(addr, size uint32, dataFormat byte) (maxBlockLen int, err error) {
+	req := []byte{
+		sidRequestDownload,
+		dataFormat,
+		0x44, // addressAndLengthFormatIdentifier: 4 bytes address, 4 bytes size
+		byte(addr >> 24), byte(addr >> 16), byte(addr >> 8), byte(addr),
+		byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size),
+	}
+	resp, err := c.request(req)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 3 {
+		return 0, fmt.Errorf("uds: malformed RequestDownload response")
+	}
+	lenFieldSize := int(resp[0] >> 4)
+	if lenFieldSize == 0 || len(resp) < 1+lenFieldSize {
+		return 0, fmt.Errorf("uds: malformed RequestDownload response")
+	}
+	var max int
+	for _, b := range resp[1 : 1+lenFieldSize] {
+		max = max<<8 | int(b)
+	}
+	return max, nil
+}
+
+// TransferData (0x36) sends one block of the download requested via
+// RequestDownload. blockSeq starts at 1 and wraps at 0xFF back to 0x00.
+func (c *Client) TransferData(blockSeq byte, data []byte) error {
+	req := append([]byte{sidTransferData, blockSeq}, data...)
+	_, err := c.request(req)
+	return err
+}
+
+// RequestTransferExit (0x37) ends a download sequence started with
+// RequestDownload.
+func (c *Client) RequestTransferExit() error {
+	_, err := c.request([]byte{sidRequestTransferExit})
+	return err
+}
+
+// RoutineControl (0x31) starts, stops, or polls the results of routineID,
+// returning whatever routine status record the ECU includes in its
+// response.
+func (c *Client) RoutineControl(subFunction byte, routineID uint16, data []byte) ([]byte, error) {
+	req := append([]byte{sidRoutineControl, subFunction, byte(routineID >> 8), byte(routineID)}, data...)
+	resp, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 3 {
+		return nil, nil
+	}
+	return resp[3:], nil
+}